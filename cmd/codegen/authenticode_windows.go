@@ -0,0 +1,188 @@
+package codegen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// expectedSignerCN is the Authenticode signer Wintun DLLs must carry.
+const expectedSignerCN = "WireGuard LLC"
+
+// wintrustActionGenericVerifyV2 is WINTRUST_ACTION_GENERIC_VERIFY_V2, the
+// action GUID requesting a standard Authenticode signature check.
+var wintrustActionGenericVerifyV2 = windows.GUID{
+	Data1: 0x00aac56b,
+	Data2: 0xcd44,
+	Data3: 0x11d0,
+	Data4: [8]byte{0x8c, 0xc2, 0x00, 0xc0, 0x4f, 0xc2, 0x95, 0xee},
+}
+
+const (
+	wtdUiNone             = 2
+	wtdRevokeNone         = 0
+	wtdChoiceFile         = 1
+	wtdStateActionVerify  = 1
+	wtdStateActionClose   = 2
+	certNameSimpleDisplay = 4
+)
+
+type wintrustFileInfo struct {
+	cbStruct      uint32
+	pcwszFilePath *uint16
+	hFile         windows.Handle
+	pgKnownSubj   *windows.GUID
+}
+
+type wintrustData struct {
+	cbStruct            uint32
+	pPolicyCallbackData uintptr
+	pSIPClientData      uintptr
+	uiChoice            uint32
+	fdwRevocationChecks uint32
+	dwUnionChoice       uint32
+	fileInfo            *wintrustFileInfo
+	stateAction         uint32
+	hWVTStateData       windows.Handle
+	pwszURLReference    *uint16
+	dwProvFlags         uint32
+	dwUIContext         uint32
+}
+
+var (
+	modwintrust                        = windows.NewLazySystemDLL("wintrust.dll")
+	procWinVerifyTrust                 = modwintrust.NewProc("WinVerifyTrust")
+	procWTHelperProvDataFromStateData  = modwintrust.NewProc("WTHelperProvDataFromStateData")
+	procWTHelperGetProvSignerFromChain = modwintrust.NewProc("WTHelperGetProvSignerFromChain")
+
+	modcrypt32             = windows.NewLazySystemDLL("crypt32.dll")
+	procCertGetNameStringW = modcrypt32.NewProc("CertGetNameStringW")
+)
+
+// verifyAuthenticode runs WinVerifyTrust against data (written to a
+// temporary file, since the API only operates on files) and checks that the
+// signer's subject matches expectedSignerCN. It is only meaningful when the
+// generator itself runs on Windows; see authenticode_other.go for other
+// hosts.
+func verifyAuthenticode(data []byte) error {
+	tmp, err := ioutil.TempFile("", "wintun-*.dll")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close temp file: %w", err)
+	}
+
+	path, err := windows.UTF16PtrFromString(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("unable to convert path: %w", err)
+	}
+
+	fileInfo := wintrustFileInfo{
+		cbStruct:      uint32(unsafe.Sizeof(wintrustFileInfo{})),
+		pcwszFilePath: path,
+	}
+	trustData := wintrustData{
+		cbStruct:            uint32(unsafe.Sizeof(wintrustData{})),
+		uiChoice:            wtdUiNone,
+		fdwRevocationChecks: wtdRevokeNone,
+		dwUnionChoice:       wtdChoiceFile,
+		fileInfo:            &fileInfo,
+		stateAction:         wtdStateActionVerify,
+	}
+
+	ret, _, _ := procWinVerifyTrust.Call(
+		uintptr(0xffffffff), // INVALID_HANDLE_VALUE: no UI
+		uintptr(unsafe.Pointer(&wintrustActionGenericVerifyV2)),
+		uintptr(unsafe.Pointer(&trustData)),
+	)
+	if ret != 0 {
+		trustData.stateAction = wtdStateActionClose
+		procWinVerifyTrust.Call(
+			uintptr(0xffffffff),
+			uintptr(unsafe.Pointer(&wintrustActionGenericVerifyV2)),
+			uintptr(unsafe.Pointer(&trustData)),
+		)
+		return fmt.Errorf("WinVerifyTrust rejected signature (code %#x)", ret)
+	}
+
+	subject, subjectErr := signerSubject(trustData.hWVTStateData)
+
+	trustData.stateAction = wtdStateActionClose
+	procWinVerifyTrust.Call(
+		uintptr(0xffffffff),
+		uintptr(unsafe.Pointer(&wintrustActionGenericVerifyV2)),
+		uintptr(unsafe.Pointer(&trustData)),
+	)
+
+	if subjectErr != nil {
+		return fmt.Errorf("unable to read signer subject: %w", subjectErr)
+	}
+	if subject != expectedSignerCN {
+		return fmt.Errorf("unexpected Authenticode signer %q, expected %q", subject, expectedSignerCN)
+	}
+	return nil
+}
+
+// filetime mirrors the Win32 FILETIME struct, used only for field alignment
+// in cryptProviderSgnr below.
+type filetime struct {
+	dwLowDateTime  uint32
+	dwHighDateTime uint32
+}
+
+// cryptProviderCert mirrors the leading fields of wintrust.h's
+// CRYPT_PROVIDER_CERT up to pCert (the only field signerSubject needs); the
+// remaining fields (fCommercial, fTrustedRoot, ...) are omitted.
+type cryptProviderCert struct {
+	cbStruct uint32
+	_        uint32 // padding: aligns pCert to 8 bytes on amd64
+	pCert    uintptr
+}
+
+// cryptProviderSgnr mirrors the leading fields of wintrust.h's
+// CRYPT_PROVIDER_SGNR up to pasCertChain (the only fields signerSubject
+// needs); the remaining fields (dwSignerType, psSigner, ...) are omitted.
+type cryptProviderSgnr struct {
+	cbStruct      uint32
+	sftVerifyAsOf filetime
+	csCertChain   uint32
+	pasCertChain  *cryptProviderCert
+}
+
+// signerSubject walks the WinVerifyTrust provider state to find the leaf
+// signer's certificate and reads its simple display name (commonly the CN).
+func signerSubject(state windows.Handle) (string, error) {
+	provData, _, _ := procWTHelperProvDataFromStateData.Call(uintptr(state))
+	if provData == 0 {
+		return "", fmt.Errorf("unable to obtain provider data")
+	}
+	signer, _, _ := procWTHelperGetProvSignerFromChain.Call(provData, 0, 0, 0)
+	if signer == 0 {
+		return "", fmt.Errorf("unable to obtain signer chain")
+	}
+	sgnr := (*cryptProviderSgnr)(unsafe.Pointer(signer))
+	if sgnr.csCertChain == 0 || sgnr.pasCertChain == nil {
+		return "", fmt.Errorf("signer has no certificate chain")
+	}
+	certCtx := sgnr.pasCertChain.pCert
+
+	buf := make([]uint16, 256)
+	procCertGetNameStringW.Call(
+		certCtx,
+		uintptr(certNameSimpleDisplay),
+		0,
+		0,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+	)
+	return windows.UTF16ToString(buf), nil
+}
@@ -0,0 +1,474 @@
+// Package codegen implements the Wintun download/verify/embed pipeline used
+// by cmd/generate.go. It carries no build tag (unlike generate.go, which is
+// "+build ignore" so it isn't part of the module's normal build) so that its
+// logic can be exercised by plain `go test ./...`, the same way fetch is
+// tested.
+package codegen
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/format"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const gitRepo = "git://git.zx2c4.com/wintun"
+const gitDir = ".git-wintun"
+const generateDir = "."
+const embeddedDir = "embedded"
+
+// DefaultDownloadRepo is the base URL Wintun archives and SHA256SUMS are
+// downloaded from absent a -repo override.
+const DefaultDownloadRepo = "https://www.wintun.net/builds"
+
+var goarchToWintunArch = map[string]string{
+	"amd64": "amd64",
+	"arm":   "arm",
+	"arm64": "arm64",
+	"386":   "x86",
+}
+
+var tplFuncs = map[string]interface{}{
+	"byteize": byteize,
+}
+var tpl = template.Must(template.New("").Funcs(tplFuncs).Parse(`//+build !wintun_fetch
+
+// Code generated by wintun-lib-embedded; DO NOT EDIT.
+package wintunlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"sync"
+)
+
+var compressedBinary = []byte{ {{ byteize . }} }
+
+var (
+	binary         []byte
+	decompressOnce sync.Once
+)
+
+func init() {
+	registerBinary(func() []byte {
+		decompressOnce.Do(func() {
+			r, err := gzip.NewReader(bytes.NewReader(compressedBinary))
+			if err != nil {
+				panic(err)
+			}
+			defer r.Close()
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				panic(err)
+			}
+			binary = data
+		})
+		return binary
+	})
+}
+
+`))
+
+// byteize renders pre-compressed bytes as a decimal byte literal for
+// inclusion in the generated source file.
+func byteize(data []byte) string {
+	sb := strings.Builder{}
+	for _, v := range data {
+		sb.WriteString(fmt.Sprintf("%d,", int(v)))
+	}
+	return sb.String()
+}
+
+// gzipCompress compresses data with gzip for embedding, keeping the
+// generated Go source (and resulting binary) much smaller than the raw DLL.
+func gzipCompress(data []byte) ([]byte, error) {
+	out := bytes.Buffer{}
+	w := gzip.NewWriter(&out)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("unable to gzip data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("unable to close gzip writer: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+func runWithOut(cmd *exec.Cmd) (out string, err error) {
+	outb, err := cmd.CombinedOutput()
+	out = string(outb)
+	code := cmd.ProcessState.ExitCode()
+	if code != -1 && code != 0 {
+		return "", fmt.Errorf("exit code %d: %s", code, out)
+	}
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+func identifyLatestVersion() (string, error) {
+	os.RemoveAll(gitDir)
+	cloneCmd := exec.Command("git", "clone", "--no-checkout", gitRepo, gitDir)
+	if _, err := runWithOut(cloneCmd); err != nil {
+		return "", fmt.Errorf("unable to clone Wintun's git: %w", err)
+	}
+	verCmd := exec.Command("git", "--git-dir", fmt.Sprintf("%s/.git", gitDir), "describe", "--tags", "--abbrev=0")
+	verOut, err := runWithOut(verCmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to get version from git repo: %w", err)
+	}
+	if err := os.RemoveAll(gitDir); err != nil {
+		return "", fmt.Errorf("failed to remove Wintun's git directory: %s", err)
+	}
+	return strings.TrimSpace(verOut), nil
+}
+
+func normalizeVersion(ver string) (string, error) {
+	trimVer := strings.TrimSpace(ver)
+	if trimVer == "" {
+		return "", fmt.Errorf("invalid version '%s'", trimVer)
+	}
+	split := strings.SplitN(trimVer, ".", 3)
+	for i := len(split) - 1; i < 3; i++ {
+		split = append(split, "0")
+	}
+	return fmt.Sprintf(
+		"%s.%s.%s",
+		split[0],
+		split[1],
+		strings.ReplaceAll(split[2], ".", "_"),
+	), nil
+}
+
+func downloadUrl(repo, version string) string {
+	log.Printf("downloading version %s", version)
+	return fmt.Sprintf("%s/wintun-%s.zip", repo, version)
+}
+
+// parseSha256Sums parses the contents of a SHA256SUMS file into a map of
+// filename to lowercase hex-encoded sha256 hash. Lines are expected in the
+// `sha256  filename` format (hash, two spaces, filename) used by Wintun's
+// release builds.
+func parseSha256Sums(sums []byte) map[string]string {
+	hashes := make(map[string]string)
+	for _, line := range strings.Split(string(sums), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		hashes[fields[1]] = strings.ToLower(fields[0])
+	}
+	return hashes
+}
+
+// verifyArchive checks zipBytes against the expected sha256 hash for
+// wintun-<version>.zip as published in repo's SHA256SUMS file, failing hard
+// on a missing entry or a hash mismatch.
+func verifyArchive(version string, zipBytes []byte, repo string) error {
+	resp, err := http.Get(repo + "/SHA256SUMS")
+	if err != nil {
+		return fmt.Errorf("unable to download SHA256SUMS: %w", err)
+	}
+	defer resp.Body.Close()
+	sums, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read SHA256SUMS: %w", err)
+	}
+
+	filename := fmt.Sprintf("wintun-%s.zip", version)
+	expected, ok := parseSha256Sums(sums)[filename]
+	if !ok {
+		return fmt.Errorf("no SHA256SUMS entry for %s", filename)
+	}
+
+	sum := sha256.Sum256(zipBytes)
+	actual := hex.EncodeToString(sum[:])
+	if actual != expected {
+		return fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", filename, expected, actual)
+	}
+	return nil
+}
+
+func unzipBinaries(zipReader io.ReaderAt, zipLen int) (map[string][]byte, error) {
+	r, err := zip.NewReader(zipReader, int64(zipLen))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create zip reader: %w", err)
+	}
+	fmap := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		fmap[f.Name] = f
+	}
+
+	bmap := make(map[string][]byte, len(goarchToWintunArch))
+	for k, v := range goarchToWintunArch {
+		name := fmt.Sprintf("wintun/bin/%s/wintun.dll", v)
+		f, ok := fmap[name]
+		if !ok {
+			return nil, fmt.Errorf("archive does not contain %s (GOARCH %s)", name, k)
+		}
+		fh, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("unable to open binary for GOARCH %s: %w", k, err)
+		}
+		data, err := ioutil.ReadAll(fh)
+		fh.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read binary for GOARCH %s: %w", k, err)
+		}
+		if err := verifyAuthenticode(data); err != nil {
+			return nil, fmt.Errorf("authenticode verification failed for GOARCH %s: %w", k, err)
+		}
+		bmap[k] = data
+	}
+	return bmap, nil
+}
+
+func generateFileForArch(arch string, compressed []byte) error {
+	if err := os.MkdirAll(generateDir, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create generate dir: %w", err)
+	}
+	out := bytes.Buffer{}
+	if err := tpl.Execute(&out, compressed); err != nil {
+		return fmt.Errorf("unable to execute template: %w", err)
+	}
+	fmtOut, err := format.Source(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("unable to format template output: %w", err)
+	}
+	fname := filepath.Join(generateDir, fmt.Sprintf("lib_windows_%s.go", arch))
+	if err := ioutil.WriteFile(fname, fmtOut, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to write output file: %w", err)
+	}
+	return nil
+}
+
+type multiVersionTplData struct {
+	Version string
+	Ident   string
+	Data    []byte
+}
+
+var tplMulti = template.Must(template.New("").Funcs(tplFuncs).Parse(`// Code generated by wintun-lib-embedded; DO NOT EDIT.
+package embedded
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"sync"
+)
+
+var compressedBinary{{ .Ident }} = []byte{ {{ byteize .Data }} }
+
+var (
+	binary{{ .Ident }}         []byte
+	decompressOnce{{ .Ident }} sync.Once
+)
+
+func init() {
+	registerVersion("{{ .Version }}", func() []byte {
+		decompressOnce{{ .Ident }}.Do(func() {
+			r, err := gzip.NewReader(bytes.NewReader(compressedBinary{{ .Ident }}))
+			if err != nil {
+				panic(err)
+			}
+			defer r.Close()
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				panic(err)
+			}
+			binary{{ .Ident }} = data
+		})
+		return binary{{ .Ident }}
+	})
+}
+
+`))
+
+// versionIdent turns a Wintun version string into a valid Go identifier
+// suffix, e.g. "0.14.1" -> "_0_14_1".
+func versionIdent(version string) string {
+	sb := strings.Builder{}
+	sb.WriteByte('_')
+	for _, r := range version {
+		switch {
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// multiVersionIdent qualifies versionIdent by arch, so that the identifiers
+// generated for the amd64 and arm64 files of the same version can't
+// redeclare each other if they're ever compiled together.
+func multiVersionIdent(version, arch string) string {
+	return versionIdent(version) + "_" + arch
+}
+
+// generateMultiVersionFileForArch writes one generated source file per
+// arch/version pair, registering it under AvailableVersions/GetBinaryVersion
+// instead of the single-version GetBinary used by generateFileForArch. The
+// filename ends in _windows_<arch>.go so Go's implicit GOOS/GOARCH filename
+// convention excludes each arch's file from the others' builds.
+func generateMultiVersionFileForArch(arch, version string, compressed []byte) error {
+	if err := os.MkdirAll(embeddedDir, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create embedded dir: %w", err)
+	}
+	out := bytes.Buffer{}
+	data := multiVersionTplData{Version: version, Ident: multiVersionIdent(version, arch), Data: compressed}
+	if err := tplMulti.Execute(&out, data); err != nil {
+		return fmt.Errorf("unable to execute template: %w", err)
+	}
+	fmtOut, err := format.Source(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("unable to format template output: %w", err)
+	}
+	fname := filepath.Join(embeddedDir, fmt.Sprintf("binary_v%s_windows_%s.go", strings.TrimPrefix(versionIdent(version), "_"), arch))
+	if err := ioutil.WriteFile(fname, fmtOut, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to write output file: %w", err)
+	}
+	return nil
+}
+
+// HasUncommittedChanges reports whether the working tree has any changes
+// generation should commit.
+func HasUncommittedChanges() (bool, error) {
+	cmd := exec.Command("git", "status", "--porcelain=v1")
+	out, err := runWithOut(cmd)
+	if err != nil {
+		return false, fmt.Errorf("unable to check git status: %w", err)
+	}
+	return len(strings.TrimSpace(out)) > 0, nil
+}
+
+// PushToGit commits the generated files, tags each embedded version and
+// pushes both to origin.
+func PushToGit(versions []string) error {
+	addCmd := exec.Command("git", "add", ".")
+	if _, err := runWithOut(addCmd); err != nil {
+		return fmt.Errorf("unable to git add: %w", err)
+	}
+	commitCmd := exec.Command("git", "commit", "-m", fmt.Sprintf("updated to Wintun version %s", strings.Join(versions, ", ")))
+	if _, err := runWithOut(commitCmd); err != nil {
+		return fmt.Errorf("unable to create commit: %w", err)
+	}
+	for _, ver := range versions {
+		tag := fmt.Sprintf("v%s", ver)
+		tagCmd := exec.Command("git", "tag", "-f", "-a", tag, "-m", fmt.Sprintf("Wintun version %s", ver))
+		if _, err := runWithOut(tagCmd); err != nil {
+			return fmt.Errorf("unable to create git tag %s: %w", tag, err)
+		}
+	}
+	pushCmd := exec.Command("git", "push", "--follow-tags")
+	if _, err := runWithOut(pushCmd); err != nil {
+		return fmt.Errorf("unable to push: %w", err)
+	}
+	for _, ver := range versions {
+		tag := fmt.Sprintf("v%s", ver)
+		tagPushCmd := exec.Command("git", "push", "origin", tag)
+		if _, err := runWithOut(tagPushCmd); err != nil {
+			return fmt.Errorf("unable to push tag %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// ResolveVersions determines which Wintun versions to embed, honouring
+// pinVersions (multiple, side-by-side) and pinVersion (a single pin) before
+// falling back to the latest git tag.
+func ResolveVersions(pinVersion, pinVersions string) ([]string, error) {
+	if pinVersions != "" {
+		var versions []string
+		for _, v := range strings.Split(pinVersions, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				versions = append(versions, v)
+			}
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("-versions given but no versions parsed")
+		}
+		return versions, nil
+	}
+	if pinVersion != "" {
+		return []string{pinVersion}, nil
+	}
+	log.Println("identifying latest Wintun version...")
+	wtver, err := identifyLatestVersion()
+	if err != nil {
+		return nil, fmt.Errorf("unable to identify latest Wintun version: %w", err)
+	}
+	return []string{wtver}, nil
+}
+
+// GenerateVersion downloads, verifies and generates source files for a
+// single Wintun version. multi selects between the single-version GetBinary
+// layout and the multi-version embedded package layout.
+func GenerateVersion(wtver string, multi bool, repo string, skipVerify bool) error {
+	ver, err := normalizeVersion(wtver)
+	if err != nil {
+		return fmt.Errorf("failed to normalize version: %w", err)
+	}
+
+	log.Printf("found ver %s (normalized %s)! downloading...", wtver, ver)
+	url := downloadUrl(repo, wtver)
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("downloading Wintun failed: %w", err)
+	}
+	defer resp.Body.Close()
+	zipBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response: %w", err)
+	}
+
+	if skipVerify {
+		log.Println("skipping archive verification (-skip-verify)")
+	} else {
+		log.Println("verifying archive against SHA256SUMS...")
+		if err := verifyArchive(wtver, zipBytes, repo); err != nil {
+			return fmt.Errorf("archive verification failed: %w", err)
+		}
+	}
+
+	log.Println("unzipping binaries")
+	bins, err := unzipBinaries(bytes.NewReader(zipBytes), len(zipBytes))
+	if err != nil {
+		return fmt.Errorf("unable to unzip Wintun binaries: %w", err)
+	}
+
+	log.Println("generating source files...")
+	for k := range goarchToWintunArch {
+		log.Printf(" - generating for %s", k)
+		compressed, err := gzipCompress(bins[k])
+		if err != nil {
+			return fmt.Errorf("unable to compress binary for GOARCH %s: %w", k, err)
+		}
+		if multi {
+			if err := generateMultiVersionFileForArch(k, wtver, compressed); err != nil {
+				return fmt.Errorf("unable to generate file: %w", err)
+			}
+		} else {
+			if err := generateFileForArch(k, compressed); err != nil {
+				return fmt.Errorf("unable to generate file: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package codegen
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseSha256Sums(t *testing.T) {
+	const sums = "abc123  wintun-0.14.1.zip\n" +
+		"DEF456  wintun-0.13.zip\n" +
+		"not a valid line\n" +
+		"\n"
+
+	hashes := parseSha256Sums([]byte(sums))
+
+	if got := hashes["wintun-0.14.1.zip"]; got != "abc123" {
+		t.Errorf("wintun-0.14.1.zip: got %q, want %q", got, "abc123")
+	}
+	if got := hashes["wintun-0.13.zip"]; got != "def456" {
+		t.Errorf("wintun-0.13.zip: got %q, want lowercased %q", got, "def456")
+	}
+	if len(hashes) != 2 {
+		t.Errorf("got %d entries, want 2 (malformed lines should be skipped)", len(hashes))
+	}
+}
+
+func TestVerifyArchive(t *testing.T) {
+	zipBytes := []byte("fake archive contents")
+	sum := sha256.Sum256(zipBytes)
+	hash := hex.EncodeToString(sum[:])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(hash + "  wintun-0.14.1.zip\n"))
+	}))
+	defer srv.Close()
+
+	if err := verifyArchive("0.14.1", zipBytes, srv.URL); err != nil {
+		t.Fatalf("verifyArchive with matching hash: %v", err)
+	}
+	if err := verifyArchive("0.13", zipBytes, srv.URL); err == nil {
+		t.Fatal("verifyArchive with missing SHA256SUMS entry: expected error, got nil")
+	}
+	if err := verifyArchive("0.14.1", []byte("tampered"), srv.URL); err == nil {
+		t.Fatal("verifyArchive with mismatched bytes: expected error, got nil")
+	}
+}
+
+func TestGzipCompressRoundTrip(t *testing.T) {
+	// Long enough that gzip's fixed header and trailer don't outweigh the
+	// savings on repeated content.
+	want := bytes.Repeat([]byte("some repeated DLL bytes "), 20)
+
+	compressed, err := gzipCompress(want)
+	if err != nil {
+		t.Fatalf("gzipCompress: %v", err)
+	}
+	if len(compressed) >= len(want) {
+		t.Errorf("compressed size %d not smaller than input size %d", len(compressed), len(want))
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading decompressed data: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("decompressed %q, want %q", got, want)
+	}
+}
+
+func TestByteize(t *testing.T) {
+	out := byteize([]byte{1, 2, 255})
+	want := "1,2,255,"
+	if out != want {
+		t.Errorf("byteize: got %q, want %q", out, want)
+	}
+
+	// The template embeds this output verbatim inside []byte{ ... }, so it
+	// must parse back to the original bytes.
+	for i, field := range strings.Split(strings.TrimRight(out, ","), ",") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			t.Fatalf("field %d (%q) is not a valid byte literal: %v", i, field, err)
+		}
+		if n < 0 || n > 255 {
+			t.Fatalf("field %d (%q) is out of byte range", i, field)
+		}
+	}
+}
+
+func TestVersionIdent(t *testing.T) {
+	cases := map[string]string{
+		"0.14.1": "_0_14_1",
+		"0.13":   "_0_13",
+	}
+	for version, want := range cases {
+		if got := versionIdent(version); got != want {
+			t.Errorf("versionIdent(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestMultiVersionIdent(t *testing.T) {
+	amd64 := multiVersionIdent("0.14.1", "amd64")
+	arm64 := multiVersionIdent("0.14.1", "arm64")
+	if amd64 == arm64 {
+		t.Fatalf("multiVersionIdent gave the same identifier for different arches: %q", amd64)
+	}
+	if want := "_0_14_1_amd64"; amd64 != want {
+		t.Errorf("multiVersionIdent(%q, %q) = %q, want %q", "0.14.1", "amd64", amd64, want)
+	}
+}
+
+func TestResolveVersionsMulti(t *testing.T) {
+	got, err := ResolveVersions("", " 0.14.1, 0.13 ,,0.10.4")
+	if err != nil {
+		t.Fatalf("ResolveVersions: %v", err)
+	}
+	want := []string{"0.14.1", "0.13", "0.10.4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveVersions() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveVersionsSinglePin(t *testing.T) {
+	got, err := ResolveVersions("0.14.1", "")
+	if err != nil {
+		t.Fatalf("ResolveVersions: %v", err)
+	}
+	want := []string{"0.14.1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveVersions() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveVersionsEmptyList(t *testing.T) {
+	if _, err := ResolveVersions("", " , , "); err == nil {
+		t.Error("ResolveVersions with only blank entries: expected error, got nil")
+	}
+}
+
+func TestUnzipBinariesMissingArch(t *testing.T) {
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	// Deliberately omit every wintun/bin/<arch>/wintun.dll entry, as an old
+	// pinned Wintun release missing e.g. arm64 would, so unzipBinaries must
+	// error instead of dereferencing a nil *zip.File.
+	if err := w.Close(); err != nil {
+		t.Fatalf("zip Close: %v", err)
+	}
+
+	if _, err := unzipBinaries(bytes.NewReader(buf.Bytes()), buf.Len()); err == nil {
+		t.Fatal("unzipBinaries against an archive missing every arch: expected error, got nil")
+	}
+}
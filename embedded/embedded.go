@@ -0,0 +1,37 @@
+// Package embedded holds the Wintun DLLs embedded by the -versions
+// multi-version generation mode, one registered version per generated
+// binary_v<ver>_windows_<goarch>.go file.
+package embedded
+
+import (
+	"fmt"
+	"sort"
+)
+
+var registry = map[string]func() []byte{}
+
+// registerVersion is called from each generated file's init() to make its
+// embedded binary available through GetBinaryVersion/AvailableVersions.
+func registerVersion(version string, get func() []byte) {
+	registry[version] = get
+}
+
+// GetBinaryVersion returns the embedded Wintun library for the given
+// version (as passed to -versions at generation time).
+func GetBinaryVersion(version string) ([]byte, error) {
+	get, ok := registry[version]
+	if !ok {
+		return nil, fmt.Errorf("embedded: no binary for version %q", version)
+	}
+	return get(), nil
+}
+
+// AvailableVersions returns the Wintun versions embedded in this build.
+func AvailableVersions() []string {
+	versions := make([]string, 0, len(registry))
+	for version := range registry {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
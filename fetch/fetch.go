@@ -0,0 +1,165 @@
+// Package fetch provides a runtime fallback for downloading and caching the
+// Wintun DLL, for use by consumers that were built without the binary
+// embedded (see the wintun_fetch build tag on the root package).
+package fetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const defaultRepo = "https://www.wintun.net/builds"
+
+var goarchToWintunArch = map[string]string{
+	"amd64": "amd64",
+	"arm":   "arm",
+	"arm64": "arm64",
+	"386":   "x86",
+}
+
+// FetchOptions configures FetchBinary.
+type FetchOptions struct {
+	// Version is the Wintun release to fetch, e.g. "0.14.1".
+	Version string
+	// Sha256 pins the expected sha256 of wintun-<Version>.zip. If empty,
+	// the hash is looked up from the published SHA256SUMS file instead.
+	Sha256 string
+	// Repo overrides the base URL binaries are downloaded from.
+	Repo string
+}
+
+// FetchBinary downloads, verifies and caches the Wintun DLL matching the
+// current GOARCH, returning its bytes. Subsequent calls for the same
+// version and arch are served from the on-disk cache under
+// os.UserCacheDir()/wintun/<version>/<arch>/wintun.dll.
+func FetchBinary(ctx context.Context, opts FetchOptions) ([]byte, error) {
+	arch, ok := goarchToWintunArch[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("unsupported GOARCH %s", runtime.GOARCH)
+	}
+	if opts.Version == "" {
+		return nil, fmt.Errorf("FetchOptions.Version is required")
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine user cache dir: %w", err)
+	}
+	cachePath := filepath.Join(cacheDir, "wintun", opts.Version, arch, "wintun.dll")
+	if data, err := ioutil.ReadFile(cachePath); err == nil {
+		return data, nil
+	}
+
+	repo := opts.Repo
+	if repo == "" {
+		repo = defaultRepo
+	}
+
+	zipBytes, err := downloadZip(ctx, repo, opts.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := opts.Sha256
+	if expected == "" {
+		expected, err = lookupSha256(ctx, repo, opts.Version)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := verifyChecksum(zipBytes, expected); err != nil {
+		return nil, err
+	}
+
+	data, err := extractBinary(zipBytes, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("unable to create cache dir: %w", err)
+	}
+	if err := ioutil.WriteFile(cachePath, data, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("unable to write cache file: %w", err)
+	}
+	return data, nil
+}
+
+func get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build request for %s: %w", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s fetching %s", resp.Status, url)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func downloadZip(ctx context.Context, repo, version string) ([]byte, error) {
+	url := fmt.Sprintf("%s/wintun-%s.zip", repo, version)
+	data, err := get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download Wintun archive: %w", err)
+	}
+	return data, nil
+}
+
+func lookupSha256(ctx context.Context, repo, version string) (string, error) {
+	sums, err := get(ctx, repo+"/SHA256SUMS")
+	if err != nil {
+		return "", fmt.Errorf("unable to download SHA256SUMS: %w", err)
+	}
+	filename := fmt.Sprintf("wintun-%s.zip", version)
+	for _, line := range strings.Split(string(sums), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "  ", 2)
+		if len(fields) == 2 && fields[1] == filename {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no SHA256SUMS entry for %s", filename)
+}
+
+func verifyChecksum(zipBytes []byte, expected string) error {
+	sum := sha256.Sum256(zipBytes)
+	actual := hex.EncodeToString(sum[:])
+	if actual != strings.ToLower(expected) {
+		return fmt.Errorf("sha256 mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+func extractBinary(zipBytes []byte, arch string) ([]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create zip reader: %w", err)
+	}
+	name := fmt.Sprintf("wintun/bin/%s/wintun.dll", arch)
+	for _, f := range r.File {
+		if f.Name != name {
+			continue
+		}
+		fh, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s: %w", name, err)
+		}
+		defer fh.Close()
+		return ioutil.ReadAll(fh)
+	}
+	return nil, fmt.Errorf("archive does not contain %s", name)
+}
@@ -0,0 +1,79 @@
+package fetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("archive contents")
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if err := verifyChecksum(data, hash); err != nil {
+		t.Errorf("matching checksum: %v", err)
+	}
+	// Expected hashes may come from SHA256SUMS with mixed case; compare
+	// case-insensitively.
+	if err := verifyChecksum(data, strings.ToUpper(hash)); err != nil {
+		t.Errorf("matching checksum with different case: %v", err)
+	}
+	if err := verifyChecksum(data, "deadbeef"); err == nil {
+		t.Error("mismatched checksum: expected error, got nil")
+	}
+}
+
+func TestExtractBinary(t *testing.T) {
+	want := []byte("fake amd64 dll bytes")
+
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("wintun/bin/amd64/wintun.dll")
+	if err != nil {
+		t.Fatalf("zip.Create: %v", err)
+	}
+	if _, err := f.Write(want); err != nil {
+		t.Fatalf("zip Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("zip Close: %v", err)
+	}
+
+	got, err := extractBinary(buf.Bytes(), "amd64")
+	if err != nil {
+		t.Fatalf("extractBinary: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("extractBinary: got %q, want %q", got, want)
+	}
+
+	if _, err := extractBinary(buf.Bytes(), "arm64"); err == nil {
+		t.Error("extractBinary for missing arch: expected error, got nil")
+	}
+}
+
+func TestLookupSha256(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ABCDEF  wintun-0.14.1.zip\n123456  wintun-0.13.zip\n"))
+	}))
+	defer srv.Close()
+
+	got, err := lookupSha256(context.Background(), srv.URL, "0.14.1")
+	if err != nil {
+		t.Fatalf("lookupSha256: %v", err)
+	}
+	if got != "abcdef" {
+		t.Errorf("lookupSha256: got %q, want %q", got, "abcdef")
+	}
+
+	if _, err := lookupSha256(context.Background(), srv.URL, "9.9.9"); err == nil {
+		t.Error("lookupSha256 for missing version: expected error, got nil")
+	}
+}
@@ -0,0 +1,10 @@
+//+build wintun_fetch
+
+package wintunlib
+
+// init registers an empty embedded binary for wintun_fetch builds, which
+// ship without the DLL compiled in and rely on GetBinaryOrFetch falling
+// back to fetch.FetchBinary at runtime instead.
+func init() {
+	registerBinary(func() []byte { return nil })
+}
@@ -0,0 +1,42 @@
+package wintunlib
+
+import (
+	"context"
+
+	"github.com/norgor/wintun-lib-embedded/fetch"
+)
+
+// embeddedBinary is populated via registerBinary by whichever generated
+// lib_windows_<arch>.go file the -version/-versions-less single-version
+// codegen path produced, or by the wintun_fetch stub when that build tag is
+// set. It stays nil if neither registers, e.g. under -versions multi-embed,
+// where GetBinary is simply unsupported.
+var embeddedBinary func() []byte
+
+// registerBinary is called from generated code (or the wintun_fetch stub)
+// to supply the single-version embedded binary, if any.
+func registerBinary(get func() []byte) {
+	embeddedBinary = get
+}
+
+// GetBinary returns the Wintun library embedded via the single-version
+// codegen path (compile time), or nil if this build doesn't carry one, such
+// as a -versions multi-embed build (use the embedded package instead) or a
+// build tagged wintun_fetch.
+func GetBinary() []byte {
+	if embeddedBinary == nil {
+		return nil
+	}
+	return embeddedBinary()
+}
+
+// GetBinaryOrFetch returns the embedded Wintun library if this build carries
+// one, falling back to fetch.FetchBinary otherwise. Builds tagged
+// wintun_fetch embed an empty binary to keep the resulting executable
+// small, relying entirely on this fallback at runtime.
+func GetBinaryOrFetch(ctx context.Context, opts fetch.FetchOptions) ([]byte, error) {
+	if bin := GetBinary(); len(bin) > 0 {
+		return bin, nil
+	}
+	return fetch.FetchBinary(ctx, opts)
+}